@@ -1,29 +1,91 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net"
+	"os"
+	"strings"
 
 	"github.com/containernetworking/cni/pkg/skel"
 	"github.com/containernetworking/cni/pkg/types"
-	"github.com/projectcalico/libcalico/lib/ipam"
+
+	"github.com/sanjaymsh/calico-cni/pkg/calicoipam"
 )
 
 func main() {
+	// Operators can invoke the same binary the runtime calls to inspect
+	// and back up pool state, e.g. `calico-ipam status <pool> --output=simple`
+	// or `calico-ipam snapshot save <file>`. Any other invocation is a CNI
+	// skel call driven by CNI_COMMAND/CNI_ARGS.
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "status":
+			runStatusCommand(os.Args[2:])
+			return
+		case "snapshot":
+			cmd := newSnapshotCommand()
+			cmd.SetArgs(os.Args[2:])
+			if err := cmd.Execute(); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
 	skel.PluginMain(cmdAdd, cmdDel)
 }
 
+func runStatusCommand(args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "usage: calico-ipam status <pool> [--output=simple|json|protobuf]")
+		os.Exit(1)
+	}
+
+	pool := args[0]
+	outputFormat := "simple"
+	for _, a := range args[1:] {
+		if strings.HasPrefix(a, "--output=") {
+			outputFormat = strings.TrimPrefix(a, "--output=")
+		}
+	}
+
+	mgr, err := calicoipam.NewManager()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	status, err := mgr.Status(context.Background(), pool)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	NewPrinter(outputFormat).PoolStatus(status)
+}
+
 // IPAMConfig represents the IP related network configuration.
 type IPAMConfig struct {
 	Name string
 	Type string    `json:"type"`
 	Args *IPAMArgs `json:"-"`
+
+	// AssignmentMode selects which IP families cmdAdd requests.
+	// Defaults to calicoipam.AssignmentModeIPv4 when unset.
+	AssignmentMode calicoipam.AssignmentMode `json:"assignment_mode,omitempty"`
+
+	// Pools is an optional list of IPv4 and/or IPv6 pool CIDRs to assign
+	// from. If no IPv4 pool is listed, IPv4 assignment falls back to
+	// calicoipam's default IPv4 pool; there is no default IPv6 pool.
+	Pools []string `json:"pools,omitempty"`
 }
 
 type IPAMArgs struct {
 	types.CommonArgs
-	IP net.IP `json:"ip,omitempty"`
+	IP                net.IP                     `json:"ip,omitempty"`
+	K8S_POD_NAMESPACE types.UnmarshallableString `json:"K8S_POD_NAMESPACE,omitempty"`
+	K8S_POD_NAME      types.UnmarshallableString `json:"K8S_POD_NAME,omitempty"`
 }
 
 type Net struct {
@@ -56,44 +118,72 @@ func LoadIPAMConfig(bytes []byte, args string) (*IPAMConfig, error) {
 }
 
 func cmdAdd(args *skel.CmdArgs) error {
-	_, err := LoadIPAMConfig(args.StdinData, args.Args)
+	conf, err := LoadIPAMConfig(args.StdinData, args.Args)
 	if err != nil {
 		return err
 	}
 
-	ipamClient, err := ipam.NewIPAMClient()
+	mgr, err := calicoipam.NewManager()
 	if err != nil {
 		return err
 	}
 
-	//TODO - does this code need to fetch the pools or should ipamClient do it automatically.
-	_, pool, _ := net.ParseCIDR("192.168.0.0/16")
-
-	// TODO - Use the workloadID as the handle (i.e. need to know about k8s)
-	addresses, _, _ := ipamClient.AutoAssign(1, 0, "", map[string]string{}, nil, pool, nil)
+	req := calicoipam.AssignRequest{
+		HandleID: GetHandleID(conf.Args, args.ContainerID),
+		Mode:     conf.AssignmentMode,
+		Pools:    conf.Pools,
+	}
+	if conf.Args != nil {
+		req.IP = conf.Args.IP
+	}
 
-	ipNetwork := net.IPNet{IP: addresses[0], Mask: net.CIDRMask(32, 32)}
+	result, err := mgr.Assign(context.Background(), req)
+	if err != nil {
+		return err
+	}
+	printerFromEnv().AssignResult(result)
 
-	r := &types.Result{
-		IP4: &types.IPConfig{IP: ipNetwork},
+	r := &types.Result{}
+	if result.IPv4 != nil {
+		r.IP4 = &types.IPConfig{IP: net.IPNet{IP: result.IPv4, Mask: net.CIDRMask(32, 32)}}
+	}
+	if result.IPv6 != nil {
+		r.IP6 = &types.IPConfig{IP: net.IPNet{IP: result.IPv6, Mask: net.CIDRMask(128, 128)}}
 	}
 	return r.Print()
 }
 
 func cmdDel(args *skel.CmdArgs) error {
-	_, err := LoadIPAMConfig(args.StdinData, args.Args)
+	conf, err := LoadIPAMConfig(args.StdinData, args.Args)
 	if err != nil {
 		return err
 	}
 
-	//TODO  - need to release the address - but don't have an API yet
-	// Release by handle - which is worloadID.
+	mgr, err := calicoipam.NewManager()
+	if err != nil {
+		return err
+	}
 
+	handleID := GetHandleID(conf.Args, args.ContainerID)
+	if err := mgr.Release(context.Background(), handleID); err != nil {
+		return err
+	}
+	printerFromEnv().ReleaseResult(handleID)
 	return nil
 }
 
-//TODO: Add ability to control IPv4 vs IPv6 assignment
+// GetHandleID returns the identifier used as the IPAM allocation handle for a
+// workload. When the CNI args carry Kubernetes pod metadata we key the
+// allocation off "<namespace>/<pod>" so it can be looked up independently of
+// the sandbox's container ID; otherwise we fall back to containerID, which is
+// the only stable identifier non-k8s callers give us.
+func GetHandleID(args *IPAMArgs, containerID string) string {
+	if args != nil && args.K8S_POD_NAMESPACE != "" && args.K8S_POD_NAME != "" {
+		return fmt.Sprintf("%s/%s", args.K8S_POD_NAMESPACE, args.K8S_POD_NAME)
+	}
+	return containerID
+}
+
 // TODO - Tests - all have an add and delete
 // k8s vs non-k8s
-// ipv4 vs ipv6 in network config
 // IP in the CNI args
@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestGetHandleID(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        *IPAMArgs
+		containerID string
+		expected    string
+	}{
+		{
+			name:        "k8s pod",
+			args:        &IPAMArgs{K8S_POD_NAMESPACE: "kube-system", K8S_POD_NAME: "coredns-1234"},
+			containerID: "cni-1234",
+			expected:    "kube-system/coredns-1234",
+		},
+		{
+			name:        "non-k8s",
+			args:        &IPAMArgs{},
+			containerID: "cni-1234",
+			expected:    "cni-1234",
+		},
+		{
+			name:        "no args",
+			args:        nil,
+			containerID: "cni-1234",
+			expected:    "cni-1234",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if handle := GetHandleID(tt.args, tt.containerID); handle != tt.expected {
+				t.Errorf("GetHandleID() = %q, want %q", handle, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/olekukonko/tablewriter"
+
+	"github.com/sanjaymsh/calico-cni/pkg/calicoipam"
+)
+
+// outputEnvVar selects the diagnostic output format for calico-ipam.
+// It never affects the CNI-required result on stdout, only the
+// assign/release/status diagnostics this plugin writes to stderr.
+const outputEnvVar = "CALICO_IPAM_OUTPUT"
+
+// Printer renders IPAM diagnostics for an operator or another tool to
+// consume, independent of the CNI result JSON the plugin must print to
+// stdout. Modeled on etcdctl's printer interface (simple/json/protobuf).
+type Printer interface {
+	AssignResult(calicoipam.AssignResult)
+	ReleaseResult(handleID string)
+	PoolStatus(calicoipam.PoolStatus)
+	SnapshotStatus(SnapshotStatus)
+}
+
+// NewPrinter returns the Printer for printerType, defaulting to simple
+// if the type is unrecognized.
+func NewPrinter(printerType string) Printer {
+	switch printerType {
+	case "json":
+		return &jsonPrinter{}
+	case "protobuf":
+		return &protobufPrinter{}
+	default:
+		return &simplePrinter{}
+	}
+}
+
+// printerFromEnv returns the Printer selected by CALICO_IPAM_OUTPUT,
+// defaulting to simple when unset.
+func printerFromEnv() Printer {
+	out := os.Getenv(outputEnvVar)
+	if out == "" {
+		out = "simple"
+	}
+	return NewPrinter(out)
+}
+
+type simplePrinter struct{}
+
+func (simplePrinter) AssignResult(r calicoipam.AssignResult) {
+	fmt.Fprintf(os.Stderr, "assigned: ipv4=%s ipv6=%s\n", r.IPv4, r.IPv6)
+}
+
+func (simplePrinter) ReleaseResult(handleID string) {
+	fmt.Fprintf(os.Stderr, "released: handle=%s\n", handleID)
+}
+
+func (simplePrinter) PoolStatus(s calicoipam.PoolStatus) {
+	fmt.Fprintf(os.Stderr, "pool=%s allocated=%d free=%d\n", s.CIDR, s.Allocated, s.Free)
+}
+
+func (simplePrinter) SnapshotStatus(s SnapshotStatus) {
+	table := tablewriter.NewWriter(os.Stderr)
+	table.SetHeader([]string{"hash", "allocation count", "pool count"})
+	table.Append([]string{
+		fmt.Sprintf("%x", s.Hash),
+		fmt.Sprint(s.AllocationCount),
+		fmt.Sprint(s.PoolCount),
+	})
+	table.Render()
+}
+
+type jsonPrinter struct{}
+
+func (jsonPrinter) AssignResult(r calicoipam.AssignResult) { printJSON(r) }
+func (jsonPrinter) ReleaseResult(handleID string) { printJSON(map[string]string{"handle": handleID}) }
+func (jsonPrinter) PoolStatus(s calicoipam.PoolStatus) { printJSON(s) }
+func (jsonPrinter) SnapshotStatus(s SnapshotStatus) { printJSON(s) }
+
+
+func printJSON(v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	fmt.Fprintln(os.Stderr, string(b))
+}
+
+// protobufPrinter exists for parity with etcdctl's printer set. None of
+// these diagnostics have generated protobuf types yet, so it falls back
+// to JSON and says so rather than silently printing the wrong format.
+type protobufPrinter struct{}
+
+func (p protobufPrinter) AssignResult(r calicoipam.AssignResult) {
+	p.unsupported()
+	printJSON(r)
+}
+
+func (p protobufPrinter) ReleaseResult(handleID string) {
+	p.unsupported()
+	printJSON(map[string]string{"handle": handleID})
+}
+
+func (p protobufPrinter) PoolStatus(s calicoipam.PoolStatus) {
+	p.unsupported()
+	printJSON(s)
+}
+
+func (p protobufPrinter) SnapshotStatus(s SnapshotStatus) {
+	p.unsupported()
+	printJSON(s)
+}
+
+func (protobufPrinter) unsupported() {
+	fmt.Fprintln(os.Stderr, "calico-ipam: protobuf output is not yet supported for this diagnostic, falling back to json")
+}
@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestNewPrinter(t *testing.T) {
+	tests := []struct {
+		printerType string
+		want        Printer
+	}{
+		{"simple", &simplePrinter{}},
+		{"json", &jsonPrinter{}},
+		{"protobuf", &protobufPrinter{}},
+		{"bogus", &simplePrinter{}},
+		{"", &simplePrinter{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.printerType, func(t *testing.T) {
+			got := NewPrinter(tt.printerType)
+			switch tt.want.(type) {
+			case *simplePrinter:
+				if _, ok := got.(*simplePrinter); !ok {
+					t.Errorf("NewPrinter(%q) = %T, want *simplePrinter", tt.printerType, got)
+				}
+			case *jsonPrinter:
+				if _, ok := got.(*jsonPrinter); !ok {
+					t.Errorf("NewPrinter(%q) = %T, want *jsonPrinter", tt.printerType, got)
+				}
+			case *protobufPrinter:
+				if _, ok := got.(*protobufPrinter); !ok {
+					t.Errorf("NewPrinter(%q) = %T, want *protobufPrinter", tt.printerType, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sanjaymsh/calico-cni/pkg/calicoipam"
+)
+
+var restoreDatastore string
+
+// SnapshotStatus summarizes a snapshot file for the "snapshot status"
+// subcommand.
+type SnapshotStatus struct {
+	Hash            uint32 `json:"hash"`
+	AllocationCount int    `json:"allocationCount"`
+	PoolCount       int    `json:"poolCount"`
+}
+
+// newSnapshotCommand returns the cobra command for "snapshot", modeled on
+// etcdctl's "snapshot save|restore|status" command family.
+func newSnapshotCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "snapshot manages the Calico IPAM allocation database.",
+	}
+	cmd.AddCommand(newSnapshotSaveCommand())
+	cmd.AddCommand(newSnapshotStatusCommand())
+	cmd.AddCommand(newSnapshotRestoreCommand())
+	return cmd
+}
+
+func newSnapshotSaveCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "save <file>",
+		Short: "save writes a consistent dump of every allocation block, handle, and pool to a file.",
+		RunE:  snapshotSaveCommandFunc,
+	}
+}
+
+func newSnapshotStatusCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status <file>",
+		Short: "status prints the hash, allocation count, and pool count of a snapshot file.",
+		RunE:  snapshotStatusCommandFunc,
+	}
+}
+
+func newSnapshotRestoreCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "restore <file>",
+		Short: "restore rebuilds IPAM state from a snapshot file into an empty datastore.",
+		RunE:  snapshotRestoreCommandFunc,
+	}
+	cmd.Flags().StringVar(&restoreDatastore, "datastore", "etcd", "Datastore backend to restore into: etcd or k8s.")
+	return cmd
+}
+
+func snapshotSaveCommandFunc(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("snapshot save expects exactly one argument")
+	}
+	path := args[0]
+
+	mgr, err := calicoipam.NewManager()
+	if err != nil {
+		return err
+	}
+	snap, err := mgr.Dump(context.Background())
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	sum := crc32.Checksum(body, crc32.MakeTable(crc32.Castagnoli))
+
+	// Write to a temp file and rename into place so a crash mid-save never
+	// leaves a corrupt file at path.
+	partPath := path + ".part"
+	f, err := os.Create(partPath)
+	if err != nil {
+		return fmt.Errorf("could not open %s: %v", partPath, err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(body); err != nil {
+		os.Remove(partPath)
+		return err
+	}
+	if err := binary.Write(f, binary.BigEndian, sum); err != nil {
+		os.Remove(partPath)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		os.Remove(partPath)
+		return err
+	}
+	if err := os.Rename(partPath, path); err != nil {
+		return fmt.Errorf("could not rename %s to %s: %v", partPath, path, err)
+	}
+
+	fmt.Printf("Snapshot saved at %s\n", path)
+	return nil
+}
+
+func snapshotStatusCommandFunc(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("snapshot status expects exactly one argument")
+	}
+
+	body, sum, err := readSnapshotFile(args[0])
+	if err != nil {
+		return err
+	}
+	if err := verifySnapshotChecksum(body, sum); err != nil {
+		return err
+	}
+
+	var snap calicoipam.Snapshot
+	if err := json.Unmarshal(body, &snap); err != nil {
+		return err
+	}
+
+	var allocationCount int
+	for _, b := range snap.Blocks {
+		allocationCount += len(b.Allocations)
+	}
+
+	printerFromEnv().SnapshotStatus(SnapshotStatus{
+		Hash:            sum,
+		AllocationCount: allocationCount,
+		PoolCount:       len(snap.Pools),
+	})
+	return nil
+}
+
+func snapshotRestoreCommandFunc(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("snapshot restore expects exactly one argument")
+	}
+	if restoreDatastore != "etcd" && restoreDatastore != "k8s" {
+		return fmt.Errorf("unsupported --datastore %q: must be etcd or k8s", restoreDatastore)
+	}
+
+	body, sum, err := readSnapshotFile(args[0])
+	if err != nil {
+		return err
+	}
+	if err := verifySnapshotChecksum(body, sum); err != nil {
+		return err
+	}
+
+	var snap calicoipam.Snapshot
+	if err := json.Unmarshal(body, &snap); err != nil {
+		return err
+	}
+
+	mgr, err := calicoipam.NewManager()
+	if err != nil {
+		return err
+	}
+	if err := mgr.Restore(context.Background(), snap, restoreDatastore); err != nil {
+		return err
+	}
+
+	fmt.Printf("Snapshot restored from %s into %s datastore\n", args[0], restoreDatastore)
+	return nil
+}
+
+// readSnapshotFile splits a snapshot file into its JSON body and its
+// trailing CRC32 checksum.
+func readSnapshotFile(path string) (body []byte, sum uint32, err error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(raw) < 4 {
+		return nil, 0, fmt.Errorf("%s is too short to contain a checksum trailer", path)
+	}
+	body = raw[:len(raw)-4]
+	sum = binary.BigEndian.Uint32(raw[len(raw)-4:])
+	return body, sum, nil
+}
+
+func verifySnapshotChecksum(body []byte, want uint32) error {
+	got := crc32.Checksum(body, crc32.MakeTable(crc32.Castagnoli))
+	if got != want {
+		return fmt.Errorf("checksum mismatch: file has %x, computed %x", want, got)
+	}
+	return nil
+}
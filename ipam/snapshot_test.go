@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadSnapshotFileRoundTrip(t *testing.T) {
+	body := []byte(`{"pools":[],"blocks":[],"handles":[]}`)
+	sum := crc32.Checksum(body, crc32.MakeTable(crc32.Castagnoli))
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "snap")
+
+	var buf []byte
+	buf = append(buf, body...)
+	sumBytes := make([]byte, 4)
+	binary.BigEndian.PutUint32(sumBytes, sum)
+	buf = append(buf, sumBytes...)
+
+	if err := ioutil.WriteFile(path, buf, 0644); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+
+	gotBody, gotSum, err := readSnapshotFile(path)
+	if err != nil {
+		t.Fatalf("readSnapshotFile() failed: %v", err)
+	}
+	if string(gotBody) != string(body) {
+		t.Errorf("readSnapshotFile() body = %q, want %q", gotBody, body)
+	}
+	if gotSum != sum {
+		t.Errorf("readSnapshotFile() sum = %x, want %x", gotSum, sum)
+	}
+	if err := verifySnapshotChecksum(gotBody, gotSum); err != nil {
+		t.Errorf("verifySnapshotChecksum() failed: %v", err)
+	}
+}
+
+func TestReadSnapshotFileTooShort(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "snap")
+	if err := ioutil.WriteFile(path, []byte("ab"), 0644); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+
+	if _, _, err := readSnapshotFile(path); err == nil {
+		t.Error("readSnapshotFile() on a too-short file expected an error, got nil")
+	}
+}
+
+func TestVerifySnapshotChecksumMismatch(t *testing.T) {
+	if err := verifySnapshotChecksum([]byte("data"), 0); err == nil {
+		t.Error("verifySnapshotChecksum() with a wrong checksum expected an error, got nil")
+	}
+}
@@ -0,0 +1,173 @@
+package calicoipam
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/projectcalico/libcalico/lib/backend"
+	"github.com/projectcalico/libcalico/lib/backend/api"
+	"github.com/projectcalico/libcalico/lib/backend/model"
+)
+
+// datastoreBackend is the subset of the libcalico backend client this
+// package needs to enumerate and (re)create IPAM data. ipam.Interface only
+// exposes per-handle/per-address operations (AssignIP, AutoAssign,
+// ReleaseByHandle); dumping or restoring the whole allocation database
+// requires reading and writing pools, blocks, and handles directly.
+type datastoreBackend interface {
+	ListPools(ctx context.Context) ([]PoolStatus, error)
+	ListBlocks(ctx context.Context) ([]BlockSnapshot, error)
+	ListHandles(ctx context.Context) ([]HandleSnapshot, error)
+
+	// CreatePool, CreateBlock, and CreateHandle use create-only semantics:
+	// they fail if the key already exists, so restore can never silently
+	// overwrite live data.
+	CreatePool(ctx context.Context, p PoolStatus) error
+	CreateBlock(ctx context.Context, b BlockSnapshot) error
+	CreateHandle(ctx context.Context, h HandleSnapshot) error
+}
+
+// libcalicoBackend adapts api.Client, the raw libcalico backend datastore
+// client, to datastoreBackend.
+type libcalicoBackend struct {
+	client api.Client
+}
+
+// newDatastoreBackend connects to the datastore named by datastoreType
+// ("etcd" or "k8s"). An empty datastoreType connects to whichever backend
+// is configured in the environment, matching ipam.NewIPAMClient's behaviour.
+func newDatastoreBackend(datastoreType string) (datastoreBackend, error) {
+	client, err := backend.NewClient(datastoreType)
+	if err != nil {
+		return nil, err
+	}
+	return &libcalicoBackend{client: client}, nil
+}
+
+func (b *libcalicoBackend) ListPools(ctx context.Context) ([]PoolStatus, error) {
+	kvps, err := b.client.List(model.IPPoolListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	pools := make([]PoolStatus, 0, len(kvps))
+	for _, kvp := range kvps {
+		key, ok := kvp.Key.(model.IPPoolKey)
+		if !ok {
+			continue
+		}
+		pools = append(pools, PoolStatus{CIDR: key.CIDR.String()})
+	}
+	return pools, nil
+}
+
+func (b *libcalicoBackend) ListBlocks(ctx context.Context) ([]BlockSnapshot, error) {
+	kvps, err := b.client.List(model.BlockListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	blocks := make([]BlockSnapshot, 0, len(kvps))
+	for _, kvp := range kvps {
+		key, ok := kvp.Key.(model.BlockKey)
+		if !ok {
+			continue
+		}
+		value, ok := kvp.Value.(*model.AllocationBlock)
+		if !ok {
+			continue
+		}
+
+		allocations := map[string]string{}
+		for ordinal, attrIndex := range value.Allocations {
+			if attrIndex == nil {
+				continue
+			}
+			attr := value.Attributes[*attrIndex]
+			if attr.AttrPrimary != nil {
+				allocations[fmt.Sprint(ordinal)] = *attr.AttrPrimary
+			}
+		}
+		blocks = append(blocks, BlockSnapshot{CIDR: key.CIDR.String(), Allocations: allocations})
+	}
+	return blocks, nil
+}
+
+func (b *libcalicoBackend) ListHandles(ctx context.Context) ([]HandleSnapshot, error) {
+	kvps, err := b.client.List(model.IPAMHandleListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	handles := make([]HandleSnapshot, 0, len(kvps))
+	for _, kvp := range kvps {
+		key, ok := kvp.Key.(model.IPAMHandleKey)
+		if !ok {
+			continue
+		}
+		value, ok := kvp.Value.(*model.IPAMHandle)
+		if !ok {
+			continue
+		}
+
+		blocks := make(map[string]int, len(value.Block))
+		for blockCIDR, count := range value.Block {
+			blocks[blockCIDR] = count
+		}
+		handles = append(handles, HandleSnapshot{HandleID: key.HandleID, Blocks: blocks})
+	}
+	return handles, nil
+}
+
+func (b *libcalicoBackend) CreatePool(ctx context.Context, p PoolStatus) error {
+	_, cidr, err := net.ParseCIDR(p.CIDR)
+	if err != nil {
+		return fmt.Errorf("invalid pool CIDR %q: %v", p.CIDR, err)
+	}
+	_, err = b.client.Create(&model.KVPair{
+		Key:   model.IPPoolKey{CIDR: *cidr},
+		Value: &model.IPPool{CIDR: *cidr},
+	})
+	return err
+}
+
+func (b *libcalicoBackend) CreateBlock(ctx context.Context, bs BlockSnapshot) error {
+	_, cidr, err := net.ParseCIDR(bs.CIDR)
+	if err != nil {
+		return fmt.Errorf("invalid block CIDR %q: %v", bs.CIDR, err)
+	}
+
+	ones, bits := cidr.Mask.Size()
+	size := 1 << uint(bits-ones)
+	allocations := make([]*int, size)
+	var attributes []model.AllocationAttribute
+	for ordinal, handleID := range bs.Allocations {
+		idx := len(attributes)
+		handleID := handleID
+		attributes = append(attributes, model.AllocationAttribute{AttrPrimary: &handleID})
+		var i int
+		if _, err := fmt.Sscanf(ordinal, "%d", &i); err != nil {
+			return fmt.Errorf("invalid allocation ordinal %q in block %s: %v", ordinal, bs.CIDR, err)
+		}
+		allocations[i] = &idx
+	}
+
+	_, err = b.client.Create(&model.KVPair{
+		Key: model.BlockKey{CIDR: *cidr},
+		Value: &model.AllocationBlock{
+			CIDR:        *cidr,
+			Allocations: allocations,
+			Attributes:  attributes,
+		},
+	})
+	return err
+}
+
+func (b *libcalicoBackend) CreateHandle(ctx context.Context, h HandleSnapshot) error {
+	_, err := b.client.Create(&model.KVPair{
+		Key:   model.IPAMHandleKey{HandleID: h.HandleID},
+		Value: &model.IPAMHandle{HandleID: h.HandleID, Block: h.Blocks},
+	})
+	return err
+}
@@ -0,0 +1,198 @@
+// Package calicoipam is a thin, programmatic wrapper around the Calico IPAM
+// client. It holds the assignment and release logic that used to live
+// directly in the calico-ipam CNI binary's cmdAdd/cmdDel, so that anything
+// that needs to manage Calico IPAM state (kubelet device plugins, IPAM
+// admission webhooks, test harnesses) can drive it as a library without
+// shelling out to the CNI binary.
+package calicoipam
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/projectcalico/libcalico/lib/ipam"
+)
+
+// AssignmentMode controls which IP families Assign requests.
+type AssignmentMode string
+
+const (
+	AssignmentModeIPv4      AssignmentMode = "ipv4"
+	AssignmentModeIPv6      AssignmentMode = "ipv6"
+	AssignmentModeDualStack AssignmentMode = "dual-stack"
+)
+
+// defaultIPv4Pool is used when a request supplies no IPv4 pool and IPv4
+// assignment is in play, preserving this plugin's historical behaviour.
+const defaultIPv4Pool = "192.168.0.0/16"
+
+// AssignRequest describes a single workload's IP assignment request.
+type AssignRequest struct {
+	// HandleID identifies the workload the assigned addresses belong to,
+	// e.g. "<namespace>/<pod>" for Kubernetes or a CNI ContainerID.
+	HandleID string
+	// Mode selects which IP families to assign. Defaults to AssignmentModeIPv4.
+	Mode AssignmentMode
+	// Pools optionally restricts assignment to specific IPv4/IPv6 pool CIDRs.
+	Pools []string
+	// IP, if set, requests this exact address instead of auto-assignment.
+	IP net.IP
+}
+
+// AssignResult holds the addresses assigned for an AssignRequest.
+type AssignResult struct {
+	IPv4 net.IP
+	IPv6 net.IP
+}
+
+// PoolStatus summarizes the utilization of an IP pool.
+type PoolStatus struct {
+	CIDR      string
+	Allocated int
+	Free      int
+}
+
+// Manager assigns and releases Calico IPAM addresses.
+type Manager interface {
+	Assign(ctx context.Context, req AssignRequest) (AssignResult, error)
+	Release(ctx context.Context, handleID string) error
+	Status(ctx context.Context, pool string) (PoolStatus, error)
+
+	// Dump and Restore back the calico-ipam snapshot save/restore subcommands.
+	Dump(ctx context.Context) (Snapshot, error)
+	Restore(ctx context.Context, snap Snapshot, datastoreType string) error
+}
+
+// ipamBackend is the subset of ipam.Interface (github.com/projectcalico/
+// libcalico/lib/ipam) that this package drives. Declaring it locally, rather
+// than depending on the full interface, lets tests substitute a fake client.
+type ipamBackend interface {
+	AssignIP(ip net.IP, handleID string, attrs map[string]string) error
+	AutoAssign(num4, num6 int, handleID string, attrs map[string]string, host *string, pool4, pool6 *net.IPNet) ([]net.IP, []net.IP, error)
+	ReleaseByHandle(handleID string) error
+}
+
+type manager struct {
+	client ipamBackend
+
+	// newBackend opens the lower-level libcalico backend client used by
+	// Status, Dump, and Restore, which need to enumerate pools/blocks/
+	// handles directly rather than through ipamBackend's per-handle API.
+	// It is a field, rather than a direct call to newDatastoreBackend, so
+	// tests can substitute a fake.
+	newBackend func(datastoreType string) (datastoreBackend, error)
+}
+
+// NewManager returns a Manager backed by a new Calico IPAM client.
+func NewManager() (Manager, error) {
+	client, err := ipam.NewIPAMClient()
+	if err != nil {
+		return nil, err
+	}
+	return &manager{client: client, newBackend: newDatastoreBackend}, nil
+}
+
+func (m *manager) Assign(ctx context.Context, req AssignRequest) (AssignResult, error) {
+	if req.IP != nil {
+		if err := m.client.AssignIP(req.IP, req.HandleID, map[string]string{}); err != nil {
+			return AssignResult{}, err
+		}
+		if req.IP.To4() != nil {
+			return AssignResult{IPv4: req.IP}, nil
+		}
+		return AssignResult{IPv6: req.IP}, nil
+	}
+
+	pool4, pool6, err := poolsByFamily(req.Pools)
+	if err != nil {
+		return AssignResult{}, err
+	}
+	if pool4 == nil && req.Mode != AssignmentModeIPv6 {
+		_, pool4, _ = net.ParseCIDR(defaultIPv4Pool)
+	}
+
+	num4, num6 := assignCounts(req.Mode)
+	v4addrs, v6addrs, err := m.client.AutoAssign(num4, num6, req.HandleID, map[string]string{}, nil, pool4, pool6)
+	if err != nil {
+		return AssignResult{}, err
+	}
+
+	var result AssignResult
+	if len(v4addrs) > 0 {
+		result.IPv4 = v4addrs[0]
+	}
+	if len(v6addrs) > 0 {
+		result.IPv6 = v6addrs[0]
+	}
+	return result, nil
+}
+
+func (m *manager) Release(ctx context.Context, handleID string) error {
+	return m.client.ReleaseByHandle(handleID)
+}
+
+// Status reports the allocated and free address counts for pool, a CIDR.
+// Both counts cover only the blocks that already exist inside the pool;
+// addresses of the pool not yet carved into a block are not counted as free.
+// Like Dump and Restore, it reads block-level allocation state through
+// datastoreBackend, since ipam.Interface only exposes per-handle/per-address
+// operations.
+func (m *manager) Status(ctx context.Context, pool string) (PoolStatus, error) {
+	_, poolCIDR, err := net.ParseCIDR(pool)
+	if err != nil {
+		return PoolStatus{}, fmt.Errorf("invalid pool %q: %v", pool, err)
+	}
+
+	be, err := m.newBackend("")
+	if err != nil {
+		return PoolStatus{}, err
+	}
+	blocks, err := be.ListBlocks(ctx)
+	if err != nil {
+		return PoolStatus{}, fmt.Errorf("listing blocks: %v", err)
+	}
+
+	status := PoolStatus{CIDR: poolCIDR.String()}
+	for _, b := range blocks {
+		_, blockCIDR, err := net.ParseCIDR(b.CIDR)
+		if err != nil || !poolCIDR.Contains(blockCIDR.IP) {
+			continue
+		}
+		ones, bits := blockCIDR.Mask.Size()
+		size := 1 << uint(bits-ones)
+		status.Allocated += len(b.Allocations)
+		status.Free += size - len(b.Allocations)
+	}
+	return status, nil
+}
+
+// assignCounts returns the number of IPv4 and IPv6 addresses AutoAssign
+// should request for the given mode. An empty mode defaults to IPv4-only.
+func assignCounts(mode AssignmentMode) (num4, num6 int) {
+	switch mode {
+	case AssignmentModeIPv6:
+		return 0, 1
+	case AssignmentModeDualStack:
+		return 1, 1
+	default:
+		return 1, 0
+	}
+}
+
+// poolsByFamily splits a list of pool CIDRs into its IPv4 and IPv6 members.
+// At most one pool per family is supported, matching AutoAssign's signature.
+func poolsByFamily(pools []string) (pool4, pool6 *net.IPNet, err error) {
+	for _, p := range pools {
+		_, cidr, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid pool %q: %v", p, err)
+		}
+		if cidr.IP.To4() != nil {
+			pool4 = cidr
+		} else {
+			pool6 = cidr
+		}
+	}
+	return pool4, pool6, nil
+}
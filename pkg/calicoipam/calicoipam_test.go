@@ -0,0 +1,120 @@
+package calicoipam
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+// fakeIPAMClient is a test double for ipamBackend.
+type fakeIPAMClient struct {
+	autoAssignV4  []net.IP
+	autoAssignV6  []net.IP
+	autoAssignErr error
+
+	assignIPErr error
+
+	assignedIP     net.IP
+	assignedHandle string
+	releasedHandle string
+}
+
+func (f *fakeIPAMClient) AssignIP(ip net.IP, handleID string, attrs map[string]string) error {
+	f.assignedIP = ip
+	f.assignedHandle = handleID
+	return f.assignIPErr
+}
+
+func (f *fakeIPAMClient) AutoAssign(num4, num6 int, handleID string, attrs map[string]string, host *string, pool4, pool6 *net.IPNet) ([]net.IP, []net.IP, error) {
+	return f.autoAssignV4, f.autoAssignV6, f.autoAssignErr
+}
+
+func (f *fakeIPAMClient) ReleaseByHandle(handleID string) error {
+	f.releasedHandle = handleID
+	return nil
+}
+
+func TestManagerAssignStaticIP(t *testing.T) {
+	fake := &fakeIPAMClient{}
+	m := &manager{client: fake}
+
+	ip := net.ParseIP("10.0.0.5")
+	result, err := m.Assign(context.Background(), AssignRequest{HandleID: "h1", IP: ip})
+	if err != nil {
+		t.Fatalf("Assign() failed: %v", err)
+	}
+	if !result.IPv4.Equal(ip) {
+		t.Errorf("Assign() IPv4 = %v, want %v", result.IPv4, ip)
+	}
+	if result.IPv6 != nil {
+		t.Errorf("Assign() IPv6 = %v, want nil", result.IPv6)
+	}
+	if fake.assignedHandle != "h1" || !fake.assignedIP.Equal(ip) {
+		t.Errorf("AssignIP called with (%v, %q), want (%v, %q)", fake.assignedIP, fake.assignedHandle, ip, "h1")
+	}
+}
+
+func TestManagerAssignDualStack(t *testing.T) {
+	v4 := net.ParseIP("10.0.0.5")
+	v6 := net.ParseIP("fd80::5")
+	fake := &fakeIPAMClient{autoAssignV4: []net.IP{v4}, autoAssignV6: []net.IP{v6}}
+	m := &manager{client: fake}
+
+	result, err := m.Assign(context.Background(), AssignRequest{HandleID: "h2", Mode: AssignmentModeDualStack})
+	if err != nil {
+		t.Fatalf("Assign() failed: %v", err)
+	}
+	if !result.IPv4.Equal(v4) || !result.IPv6.Equal(v6) {
+		t.Errorf("Assign() = %+v, want IPv4=%v IPv6=%v", result, v4, v6)
+	}
+}
+
+func TestManagerRelease(t *testing.T) {
+	fake := &fakeIPAMClient{}
+	m := &manager{client: fake}
+
+	if err := m.Release(context.Background(), "h3"); err != nil {
+		t.Fatalf("Release() failed: %v", err)
+	}
+	if fake.releasedHandle != "h3" {
+		t.Errorf("ReleaseByHandle called with %q, want %q", fake.releasedHandle, "h3")
+	}
+}
+
+func TestAssignCounts(t *testing.T) {
+	tests := []struct {
+		mode       AssignmentMode
+		num4, num6 int
+	}{
+		{mode: "", num4: 1, num6: 0},
+		{mode: AssignmentModeIPv4, num4: 1, num6: 0},
+		{mode: AssignmentModeIPv6, num4: 0, num6: 1},
+		{mode: AssignmentModeDualStack, num4: 1, num6: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			num4, num6 := assignCounts(tt.mode)
+			if num4 != tt.num4 || num6 != tt.num6 {
+				t.Errorf("assignCounts(%q) = (%d, %d), want (%d, %d)", tt.mode, num4, num6, tt.num4, tt.num6)
+			}
+		})
+	}
+}
+
+func TestPoolsByFamily(t *testing.T) {
+	pool4, pool6, err := poolsByFamily([]string{"10.0.0.0/24", "fd80::/120"})
+	if err != nil {
+		t.Fatalf("poolsByFamily() returned error: %v", err)
+	}
+	if pool4 == nil || pool4.String() != "10.0.0.0/24" {
+		t.Errorf("pool4 = %v, want 10.0.0.0/24", pool4)
+	}
+	if pool6 == nil || pool6.String() != "fd80::/120" {
+		t.Errorf("pool6 = %v, want fd80::/120", pool6)
+	}
+
+	if _, _, err := poolsByFamily([]string{"not-a-cidr"}); err == nil {
+		t.Error("poolsByFamily() with an invalid CIDR expected an error, got nil")
+	}
+}
@@ -0,0 +1,127 @@
+package calicoipam
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+// fakeDatastoreBackend is a test double for datastoreBackend.
+type fakeDatastoreBackend struct {
+	pools   []PoolStatus
+	blocks  []BlockSnapshot
+	handles []HandleSnapshot
+
+	created struct {
+		pools   []PoolStatus
+		blocks  []BlockSnapshot
+		handles []HandleSnapshot
+	}
+
+	existingKeys map[string]bool
+}
+
+func (f *fakeDatastoreBackend) ListPools(ctx context.Context) ([]PoolStatus, error) {
+	return f.pools, nil
+}
+
+func (f *fakeDatastoreBackend) ListBlocks(ctx context.Context) ([]BlockSnapshot, error) {
+	return f.blocks, nil
+}
+
+func (f *fakeDatastoreBackend) ListHandles(ctx context.Context) ([]HandleSnapshot, error) {
+	return f.handles, nil
+}
+
+func (f *fakeDatastoreBackend) CreatePool(ctx context.Context, p PoolStatus) error {
+	if f.existingKeys["pool/"+p.CIDR] {
+		return fmt.Errorf("pool %s already exists", p.CIDR)
+	}
+	f.created.pools = append(f.created.pools, p)
+	return nil
+}
+
+func (f *fakeDatastoreBackend) CreateBlock(ctx context.Context, b BlockSnapshot) error {
+	if f.existingKeys["block/"+b.CIDR] {
+		return fmt.Errorf("block %s already exists", b.CIDR)
+	}
+	f.created.blocks = append(f.created.blocks, b)
+	return nil
+}
+
+func (f *fakeDatastoreBackend) CreateHandle(ctx context.Context, h HandleSnapshot) error {
+	if f.existingKeys["handle/"+h.HandleID] {
+		return fmt.Errorf("handle %s already exists", h.HandleID)
+	}
+	f.created.handles = append(f.created.handles, h)
+	return nil
+}
+
+func newManagerWithBackend(be datastoreBackend) *manager {
+	return &manager{newBackend: func(string) (datastoreBackend, error) { return be, nil }}
+}
+
+func TestManagerStatus(t *testing.T) {
+	be := &fakeDatastoreBackend{
+		blocks: []BlockSnapshot{
+			{CIDR: "10.0.0.0/30", Allocations: map[string]string{"0": "h1", "1": "h2"}},
+			{CIDR: "10.1.0.0/30", Allocations: map[string]string{"0": "h3"}},
+		},
+	}
+	m := newManagerWithBackend(be)
+
+	status, err := m.Status(context.Background(), "10.0.0.0/24")
+	if err != nil {
+		t.Fatalf("Status() failed: %v", err)
+	}
+	if status.Allocated != 2 || status.Free != 2 {
+		t.Errorf("Status() = %+v, want Allocated=2 Free=2 (block outside the pool must be excluded)", status)
+	}
+}
+
+func TestManagerDump(t *testing.T) {
+	be := &fakeDatastoreBackend{
+		pools:   []PoolStatus{{CIDR: "10.0.0.0/24"}},
+		blocks:  []BlockSnapshot{{CIDR: "10.0.0.0/30", Allocations: map[string]string{"0": "h1"}}},
+		handles: []HandleSnapshot{{HandleID: "h1", Blocks: map[string]int{"10.0.0.0/30": 1}}},
+	}
+	m := newManagerWithBackend(be)
+
+	snap, err := m.Dump(context.Background())
+	if err != nil {
+		t.Fatalf("Dump() failed: %v", err)
+	}
+	if len(snap.Pools) != 1 || len(snap.Blocks) != 1 || len(snap.Handles) != 1 {
+		t.Errorf("Dump() = %+v, want one of each", snap)
+	}
+}
+
+func TestManagerRestoreRefusesNonEmptyDatastore(t *testing.T) {
+	be := &fakeDatastoreBackend{pools: []PoolStatus{{CIDR: "10.0.0.0/24"}}}
+	m := newManagerWithBackend(be)
+
+	snap := Snapshot{Pools: []PoolStatus{{CIDR: "10.1.0.0/24"}}}
+	if err := m.Restore(context.Background(), snap, "etcd"); err == nil {
+		t.Error("Restore() into a non-empty datastore expected an error, got nil")
+	}
+	if len(be.created.pools) != 0 {
+		t.Errorf("Restore() created %d pool(s) despite refusing, want 0", len(be.created.pools))
+	}
+}
+
+func TestManagerRestore(t *testing.T) {
+	be := &fakeDatastoreBackend{existingKeys: map[string]bool{}}
+	m := newManagerWithBackend(be)
+
+	snap := Snapshot{
+		Pools:   []PoolStatus{{CIDR: "10.0.0.0/24"}},
+		Blocks:  []BlockSnapshot{{CIDR: "10.0.0.0/30", Allocations: map[string]string{"0": "h1"}}},
+		Handles: []HandleSnapshot{{HandleID: "h1", Blocks: map[string]int{"10.0.0.0/30": 1}}},
+	}
+	if err := m.Restore(context.Background(), snap, "etcd"); err != nil {
+		t.Fatalf("Restore() failed: %v", err)
+	}
+	if len(be.created.pools) != 1 || len(be.created.blocks) != 1 || len(be.created.handles) != 1 {
+		t.Errorf("Restore() created %+v, want one of each", be.created)
+	}
+}